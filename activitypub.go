@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-fed/httpsig"
+)
+
+// apHTTPClient is used for all outbound federation requests (fetching a
+// remote actor's key, delivering activities). A bounded timeout keeps a
+// slow or hostile remote from hanging the request/delivery goroutine.
+var apHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// validateFederationTarget rejects URLs that aren't plausible remote
+// ActivityPub endpoints, guarding the keyId/inbox URLs we fetch (which
+// come from attacker-controlled HTTP headers and activity bodies) against
+// SSRF: only https URLs resolving to public, non-loopback addresses pass.
+func validateFederationTarget(rawurl string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("federation target %q must use https", rawurl)
+	}
+	ips, err := net.LookupIP(u.Hostname())
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+			return fmt.Errorf("federation target %q resolves to a disallowed address", rawurl)
+		}
+	}
+	return nil
+}
+
+// actorName is the single actor this blog exposes to the fediverse.
+const actorName = "blog"
+
+// Actor is the minimal ActivityStreams actor representation served at
+// the actor URL and referenced from WebFinger.
+type Actor struct {
+	Context           []string    `json:"@context"`
+	ID                string      `json:"id"`
+	Type              string      `json:"type"`
+	PreferredUsername string      `json:"preferredUsername"`
+	Inbox             string      `json:"inbox"`
+	Outbox            string      `json:"outbox"`
+	Followers         string      `json:"followers"`
+	PublicKey         ActorPubKey `json:"publicKey"`
+}
+
+type ActorPubKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+// Activity is a loosely typed envelope big enough to cover the
+// Create/Follow/Undo activities this blog sends and receives.
+type Activity struct {
+	Context string          `json:"@context"`
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Actor   string          `json:"actor"`
+	Object  json.RawMessage `json:"object"`
+}
+
+type apFollower struct {
+	ActorID     string
+	Inbox       string
+	SharedInbox string
+}
+
+func actorURL(host string) string {
+	return fmt.Sprintf("https://%s/ap/actor", host)
+}
+
+func (a *App) createAPTables() error {
+	_, err := a.db.Exec(`
+        CREATE TABLE IF NOT EXISTS ap_keys(
+            id          INT PRIMARY KEY DEFAULT 1,
+            private_pem TEXT NOT NULL,
+            public_pem  TEXT NOT NULL
+        )
+    `)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.db.Exec(`
+        CREATE TABLE IF NOT EXISTS ap_followers(
+            actor_id     TEXT PRIMARY KEY,
+            inbox        TEXT NOT NULL,
+            shared_inbox TEXT NOT NULL DEFAULT '',
+            date         TIMESTAMP DEFAULT NOW()
+        )
+    `)
+	return err
+}
+
+// loadOrCreateAPKeys returns the blog's RSA keypair, generating and
+// persisting one to ap_keys on first use.
+func (a *App) loadOrCreateAPKeys() (*rsa.PrivateKey, error) {
+	var privPem, pubPem string
+	err := a.db.QueryRow(`SELECT private_pem, public_pem FROM ap_keys WHERE id=1`).Scan(&privPem, &pubPem)
+	if err == sql.ErrNoRows {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		privBytes := x509.MarshalPKCS1PrivateKey(key)
+		privPem := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: privBytes}))
+		pubBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		pubPem := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes}))
+		_, err = a.db.Exec(`INSERT INTO ap_keys(id, private_pem, public_pem) VALUES(1,$1,$2)`, privPem, pubPem)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(privPem))
+	if block == nil {
+		return nil, fmt.Errorf("ap_keys: invalid private key pem")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+func (a *App) insertFollower(f apFollower) error {
+	_, err := a.db.Exec(`
+        INSERT INTO ap_followers(actor_id, inbox, shared_inbox) VALUES($1,$2,$3)
+        ON CONFLICT (actor_id) DO UPDATE SET inbox=$2, shared_inbox=$3`,
+		f.ActorID, f.Inbox, f.SharedInbox)
+	return err
+}
+
+func (a *App) deleteFollower(actorID string) error {
+	_, err := a.db.Exec(`DELETE FROM ap_followers WHERE actor_id=$1`, actorID)
+	return err
+}
+
+func (a *App) getFollowers() ([]apFollower, error) {
+	rows, err := a.db.Query(`SELECT actor_id, inbox, shared_inbox FROM ap_followers`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []apFollower
+	for rows.Next() {
+		var f apFollower
+		if err := rows.Scan(&f.ActorID, &f.Inbox, &f.SharedInbox); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// handleWebfinger answers acct:blog@host lookups with a link to the actor.
+func (a *App) handleWebfinger(w http.ResponseWriter, r *http.Request) {
+	resource := r.URL.Query().Get("resource")
+	want := fmt.Sprintf("acct:%s@%s", actorName, r.Host)
+	if resource != want {
+		http.NotFound(w, r)
+		return
+	}
+	resp := map[string]interface{}{
+		"subject": want,
+		"links": []map[string]string{
+			{
+				"rel":  "self",
+				"type": "application/activity+json",
+				"href": actorURL(r.Host),
+			},
+		},
+	}
+	w.Header().Set("Content-Type", "application/jrd+json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleActor serves this blog's Person actor document.
+func (a *App) handleActor(w http.ResponseWriter, r *http.Request) {
+	key, err := a.loadOrCreateAPKeys()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	pubBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	pubPem := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes}))
+
+	base := actorURL(r.Host)
+	actor := Actor{
+		Context:           []string{"https://www.w3.org/ns/activitystreams", "https://w3id.org/security/v1"},
+		ID:                base,
+		Type:              "Person",
+		PreferredUsername: actorName,
+		Inbox:             base + "/inbox",
+		Outbox:            base + "/outbox",
+		Followers:         base + "/followers",
+		PublicKey: ActorPubKey{
+			ID:           base + "#main-key",
+			Owner:        base,
+			PublicKeyPem: pubPem,
+		},
+	}
+	w.Header().Set("Content-Type", "application/activity+json")
+	json.NewEncoder(w).Encode(actor)
+}
+
+// handleOutbox serves an empty OrderedCollection. This blog only pushes
+// Create activities directly to followers' inboxes; it doesn't keep a
+// queryable outbox, but still needs to answer the URL it advertises.
+func (a *App) handleOutbox(w http.ResponseWriter, r *http.Request) {
+	base := actorURL(r.Host)
+	resp := map[string]interface{}{
+		"@context":     "https://www.w3.org/ns/activitystreams",
+		"id":           base + "/outbox",
+		"type":         "OrderedCollection",
+		"totalItems":   0,
+		"orderedItems": []interface{}{},
+	}
+	w.Header().Set("Content-Type", "application/activity+json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleFollowers serves the follower count as an OrderedCollection.
+func (a *App) handleFollowers(w http.ResponseWriter, r *http.Request) {
+	followers, err := a.getFollowers()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	base := actorURL(r.Host)
+	resp := map[string]interface{}{
+		"@context":     "https://www.w3.org/ns/activitystreams",
+		"id":           base + "/followers",
+		"type":         "OrderedCollection",
+		"totalItems":   len(followers),
+		"orderedItems": []interface{}{},
+	}
+	w.Header().Set("Content-Type", "application/activity+json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleInbox verifies and processes Follow/Undo activities addressed to us.
+func (a *App) handleInbox(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, signer, err := a.verifyInboundSignature(r)
+	if err != nil {
+		http.Error(w, "signature verification failed: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var act Activity
+	if err := json.Unmarshal(body, &act); err != nil {
+		http.Error(w, "bad activity", http.StatusBadRequest)
+		return
+	}
+
+	// The signing key must belong to the actor the activity claims to be
+	// from — otherwise any valid keypair could Follow/Undo as anyone.
+	if signer.ID != act.Actor {
+		http.Error(w, "signing key does not match activity actor", http.StatusForbidden)
+		return
+	}
+
+	switch act.Type {
+	case "Follow":
+		f := apFollower{ActorID: act.Actor, Inbox: signer.Inbox}
+		if err := a.insertFollower(f); err != nil {
+			log.Println("insertFollower:", err)
+		}
+		go a.sendAccept(r.Host, act)
+	case "Undo":
+		if err := a.deleteFollower(act.Actor); err != nil {
+			log.Println("deleteFollower:", err)
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// verifyInboundSignature checks the request's HTTP signature against the
+// sending actor's published public key and returns the raw body along
+// with the actor document the key was fetched from, so the caller can
+// bind the verified key owner to the activity's claimed actor.
+func (a *App) verifyInboundSignature(r *http.Request) ([]byte, *Actor, error) {
+	verifier, err := httpsig.NewVerifier(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyID := verifier.KeyId()
+	remote, err := fetchRemoteActor(keyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if remote.PublicKey.ID != keyID {
+		return nil, nil, fmt.Errorf("keyId %q is not the key %s advertises", keyID, remote.ID)
+	}
+	pubKey, err := parseRSAPublicKeyPEM(remote.PublicKey.PublicKeyPem)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := verifier.Verify(pubKey, httpsig.RSA_SHA256); err != nil {
+		return nil, nil, err
+	}
+	body, err := io.ReadAll(r.Body)
+	return body, remote, err
+}
+
+// fetchRemoteActor fetches and decodes the actor document that owns keyID.
+func fetchRemoteActor(keyID string) (*Actor, error) {
+	actorID := strings.SplitN(keyID, "#", 2)[0]
+	if err := validateFederationTarget(actorID); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, actorID, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/activity+json")
+	resp, err := apHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var remote Actor
+	if err := json.NewDecoder(resp.Body).Decode(&remote); err != nil {
+		return nil, err
+	}
+	return &remote, nil
+}
+
+func parseRSAPublicKeyPEM(pemStr string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemStr))
+	if block == nil {
+		return nil, fmt.Errorf("invalid remote public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("remote key is not RSA")
+	}
+	return rsaPub, nil
+}
+
+// sendAccept replies to a Follow with an Accept so the remote server
+// finishes the handshake. ourHost is the host the Follow was received on,
+// used to build our own actor URL (not the remote inbox's host).
+func (a *App) sendAccept(ourHost string, follow Activity) {
+	accept := Activity{
+		Context: "https://www.w3.org/ns/activitystreams",
+		ID:      follow.Actor + "#accept",
+		Type:    "Accept",
+		Actor:   actorURL(ourHost),
+		Object:  mustMarshal(follow),
+	}
+	if err := a.deliverActivity(ourHost, follow.Actor+"/inbox", accept); err != nil {
+		log.Println("sendAccept:", err)
+	}
+}
+
+// federatePost builds a Create/Note activity for a new post and
+// delivers it to every known follower's inbox.
+func (a *App) federatePost(host string, p Post) {
+	followers, err := a.getFollowers()
+	if err != nil {
+		log.Println("federatePost: getFollowers:", err)
+		return
+	}
+	note := map[string]interface{}{
+		"id":           fmt.Sprintf("https://%s/post/%s", host, p.ID),
+		"type":         "Note",
+		"attributedTo": actorURL(host),
+		"content":      p.Text,
+		"published":    p.Date.Format(time.RFC3339),
+	}
+	create := Activity{
+		Context: "https://www.w3.org/ns/activitystreams",
+		ID:      fmt.Sprintf("https://%s/post/%s#create", host, p.ID),
+		Type:    "Create",
+		Actor:   actorURL(host),
+		Object:  mustMarshal(note),
+	}
+	for _, f := range followers {
+		go func(f apFollower) {
+			if err := a.deliverActivity(host, f.Inbox, create); err != nil {
+				log.Println("federatePost: deliver to", f.Inbox, ":", err)
+			}
+		}(f)
+	}
+}
+
+// deliverActivity signs and POSTs an activity to a remote inbox using
+// rsa-sha256 over (request-target) host date digest, per RFC draft
+// cavage-http-signatures as implemented by go-fed/httpsig. ourHost is the
+// blog's own host, used for the keyId — not the inbox's host.
+func (a *App) deliverActivity(ourHost, inbox string, act Activity) error {
+	if err := validateFederationTarget(inbox); err != nil {
+		return err
+	}
+	key, err := a.loadOrCreateAPKeys()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(act)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/activity+json")
+	req.Header.Set("Accept", "application/activity+json")
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+
+	signer, _, err := httpsig.NewSigner(
+		[]httpsig.Algorithm{httpsig.RSA_SHA256},
+		httpsig.DigestSha256,
+		[]string{httpsig.RequestTarget, "host", "date", "digest"},
+		httpsig.Signature, 0)
+	if err != nil {
+		return err
+	}
+	if err := signer.SignRequest(key, actorURL(ourHost)+"#main-key", req, body); err != nil {
+		return err
+	}
+
+	resp, err := apHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("inbox %s returned %s", inbox, resp.Status)
+	}
+	return nil
+}
+
+func mustMarshal(v interface{}) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strconv"
+)
+
+// apiError is the envelope every /api/v1/ error response uses.
+type apiError struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	var e apiError
+	e.Error.Code = code
+	e.Error.Message = message
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(e)
+}
+
+func writeAPIJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// apiPostsPage is the JSON shape returned by GET /api/v1/posts.
+type apiPostsPage struct {
+	Posts []Post `json:"posts"`
+	Page  int    `json:"page"`
+	Last  int    `json:"last"`
+	Total int    `json:"total"`
+}
+
+// handleAPIPosts dispatches GET (list) and POST (create, authenticated)
+// on /api/v1/posts.
+func (a *App) handleAPIPosts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.apiListPosts(w, r)
+	case http.MethodPost:
+		a.requireAuthAPI(a.apiCreatePost)(w, r)
+	default:
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+	}
+}
+
+func (a *App) apiListPosts(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage := 10
+	posts, total, err := a.getPostsPage(page, perPage)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	last := (total + perPage - 1) / perPage
+	writeAPIJSON(w, apiPostsPage{Posts: posts, Page: page, Last: last, Total: total})
+}
+
+type apiCreatePostRequest struct {
+	Title     string   `json:"title"`
+	Text      string   `json:"text"`
+	Images    []string `json:"images"` // base64-encoded image data
+	Status    string   `json:"status"`
+	PublishAt string   `json:"publish_at"`
+}
+
+func (a *App) apiCreatePost(w http.ResponseWriter, r *http.Request) {
+	var title, text, status, publishAtStr string
+	var imgs Images
+	var err error
+
+	if ct := r.Header.Get("Content-Type"); len(ct) >= 16 && ct[:16] == "application/json" {
+		var req apiCreatePostRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "bad_request", "invalid json body")
+			return
+		}
+		title, text, status, publishAtStr = req.Title, req.Text, req.Status, req.PublishAt
+		imgs, err = decodeBase64Images(a.images, req.Images)
+	} else {
+		if err := r.ParseMultipartForm(10 << 20); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "bad_request", "invalid multipart form")
+			return
+		}
+		title = r.FormValue("title")
+		text = r.FormValue("text")
+		status = r.FormValue("status")
+		publishAtStr = r.FormValue("publish_at")
+		imgs, err = a.images.Process(r.MultipartForm.File["images"])
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	postStatus, publishAt, err := parseScheduleForm(status, publishAtStr)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+
+	p, err := a.insertPost(title, text, imgs, postStatus, publishAt)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	if err := a.insertPostTags(p.ID, extractHashtags(p.Text)); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	if p.Status == StatusPublished {
+		go a.federatePost(r.Host, p)
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	writeAPIJSON(w, p)
+}
+
+// handleAPIPost serves GET /api/v1/posts/{id}, applying the same
+// preview-token gate as handlePreviewablePost.
+func (a *App) handleAPIPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	id := filepath.Base(r.URL.Path)
+	p, err := a.getPost(id)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "not_found", "post not found")
+		return
+	}
+	if !isPreviewAuthorized(p, r.URL.Query().Get("preview")) {
+		writeAPIError(w, http.StatusNotFound, "not_found", "post not found")
+		return
+	}
+	writeAPIJSON(w, p)
+}
+
+type apiLetterRequest struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Message string `json:"message"`
+}
+
+// handleAPILetters serves POST /api/v1/letters.
+func (a *App) handleAPILetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+		return
+	}
+	var req apiLetterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "invalid json body")
+		return
+	}
+	if err := a.insertMessage(req.Name, req.Email, req.Message); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// decodeBase64Images decodes base64 image payloads and runs them through
+// the same ImageProcessor multipart uploads use.
+func decodeBase64Images(ip *ImageProcessor, encoded []string) (Images, error) {
+	var decoded [][]byte
+	for _, e := range encoded {
+		b, err := base64.StdEncoding.DecodeString(e)
+		if err != nil {
+			return nil, err
+		}
+		decoded = append(decoded, b)
+	}
+	return ip.ProcessBytes(decoded)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	rl := newRateLimiter(2, time.Hour)
+
+	if !rl.Allow("a") {
+		t.Fatal("expected first request to be allowed")
+	}
+	if !rl.Allow("a") {
+		t.Fatal("expected second request to be allowed")
+	}
+	if rl.Allow("a") {
+		t.Fatal("expected third request to be blocked")
+	}
+
+	if !rl.Allow("b") {
+		t.Fatal("expected a different key to have its own bucket")
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	rl := newRateLimiter(1, time.Millisecond)
+
+	if !rl.Allow("a") {
+		t.Fatal("expected first request to be allowed")
+	}
+	if rl.Allow("a") {
+		t.Fatal("expected bucket to be empty")
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if !rl.Allow("a") {
+		t.Fatal("expected bucket to have refilled after interval elapsed")
+	}
+}
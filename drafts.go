@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+var errInvalidStatus = errors.New("invalid post status")
+
+// Post statuses. A post only appears in public listings once it is
+// "published"; "draft" and "scheduled" posts are reachable solely via
+// their preview link.
+const (
+	StatusDraft     = "draft"
+	StatusScheduled = "scheduled"
+	StatusPublished = "published"
+)
+
+func (a *App) createDraftColumns() error {
+	_, err := a.db.Exec(`
+        ALTER TABLE blog_posts
+        ADD COLUMN IF NOT EXISTS status        VARCHAR(16) NOT NULL DEFAULT 'published',
+        ADD COLUMN IF NOT EXISTS publish_at    TIMESTAMP,
+        ADD COLUMN IF NOT EXISTS preview_token TEXT NOT NULL DEFAULT ''
+    `)
+	return err
+}
+
+// parseScheduleForm reads the "status" and "publish_at" fields the create
+// form submits and validates them into a status/publishAt pair suitable
+// for insertPost.
+func parseScheduleForm(status, publishAtStr string) (string, *time.Time, error) {
+	switch status {
+	case "", StatusPublished:
+		return StatusPublished, nil, nil
+	case StatusDraft:
+		return StatusDraft, nil, nil
+	case StatusScheduled:
+		t, err := time.Parse("2006-01-02T15:04", publishAtStr)
+		if err != nil {
+			return "", nil, err
+		}
+		return StatusScheduled, &t, nil
+	default:
+		return "", nil, errInvalidStatus
+	}
+}
+
+func newPreviewToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// startScheduledPublisher ticks every minute promoting scheduled posts
+// whose publish_at has passed to published.
+func (a *App) startScheduledPublisher() {
+	ticker := time.NewTicker(time.Minute)
+	go func() {
+		for range ticker.C {
+			if err := a.promoteScheduledPosts(); err != nil {
+				log.Println("promoteScheduledPosts:", err)
+			}
+		}
+	}()
+}
+
+// promoteScheduledPosts flips due scheduled posts to published and
+// federates each one, since federation is skipped at create time for
+// anything that isn't published yet.
+func (a *App) promoteScheduledPosts() error {
+	rows, err := a.db.Query(`
+        UPDATE blog_posts SET status='published'
+        WHERE status='scheduled' AND publish_at <= NOW()
+        RETURNING id::text, title, body, images, date, status, publish_at, preview_token`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var promoted []Post
+	for rows.Next() {
+		var p Post
+		if err := rows.Scan(&p.ID, &p.Title, &p.Text, &p.Images, &p.Date, &p.Status, &p.PublishAt, &p.PreviewToken); err != nil {
+			return err
+		}
+		promoted = append(promoted, p)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range promoted {
+		go a.federatePost(a.host, p)
+	}
+	return nil
+}
+
+// isPreviewAuthorized reports whether a caller may view p: either it's
+// published, or they supplied p's preview token. Shared by
+// handlePreviewablePost and the equivalent JSON API route.
+func isPreviewAuthorized(p Post, token string) bool {
+	return p.Status == StatusPublished || token == p.PreviewToken
+}
+
+// handlePreviewablePost serves a post by id, allowing access to
+// non-published posts only when ?preview=<token> matches.
+func (a *App) handlePreviewablePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := filepath.Base(r.URL.Path)
+	p, err := a.getPost(id)
+	if err != nil {
+		http.Error(w, "post not found", 404)
+		return
+	}
+	if !isPreviewAuthorized(p, r.URL.Query().Get("preview")) {
+		http.Error(w, "post not found", 404)
+		return
+	}
+	if err := a.tmpl.ExecuteTemplate(w, "post.html", p); err != nil {
+		log.Println(err)
+	}
+}
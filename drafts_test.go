@@ -0,0 +1,62 @@
+package main
+
+import "testing"
+
+func TestParseScheduleForm(t *testing.T) {
+	cases := []struct {
+		name       string
+		status     string
+		publishAt  string
+		wantStatus string
+		wantErr    bool
+	}{
+		{"empty defaults to published", "", "", StatusPublished, false},
+		{"explicit published", StatusPublished, "", StatusPublished, false},
+		{"draft", StatusDraft, "", StatusDraft, false},
+		{"scheduled with valid time", StatusScheduled, "2026-01-02T15:04", StatusScheduled, false},
+		{"scheduled with invalid time", StatusScheduled, "not-a-time", "", true},
+		{"unknown status", "bogus", "", "", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			status, publishAt, err := parseScheduleForm(c.status, c.publishAt)
+			if c.wantErr {
+				if err == nil {
+					t.Fatal("expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if status != c.wantStatus {
+				t.Errorf("status = %q, want %q", status, c.wantStatus)
+			}
+			if c.wantStatus == StatusScheduled && publishAt == nil {
+				t.Error("expected a non-nil publishAt for a scheduled post")
+			}
+			if c.wantStatus != StatusScheduled && publishAt != nil {
+				t.Error("expected a nil publishAt for a non-scheduled post")
+			}
+		})
+	}
+}
+
+func TestIsPreviewAuthorized(t *testing.T) {
+	published := Post{Status: StatusPublished, PreviewToken: "tok"}
+	if !isPreviewAuthorized(published, "") {
+		t.Error("published posts should be visible with no token")
+	}
+
+	draft := Post{Status: StatusDraft, PreviewToken: "tok"}
+	if isPreviewAuthorized(draft, "") {
+		t.Error("drafts should not be visible with no token")
+	}
+	if isPreviewAuthorized(draft, "wrong") {
+		t.Error("drafts should not be visible with a mismatched token")
+	}
+	if !isPreviewAuthorized(draft, "tok") {
+		t.Error("drafts should be visible with the matching preview token")
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+
+	"github.com/chai2010/webp"
+	"github.com/disintegration/imaging"
+	xwebp "golang.org/x/image/webp"
+)
+
+// Image is one processed variant set for a single upload: three sizes
+// plus the metadata post.html needs to build a responsive <picture>.
+type Image struct {
+	Full   string `json:"full"`
+	Med    string `json:"med"`
+	Thumb  string `json:"thumb"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Mime   string `json:"mime"`
+}
+
+// Images is the []Image slice stored in blog_posts.images JSONB.
+type Images []Image
+
+func (imgs Images) Value() (driver.Value, error) {
+	return json.Marshal(imgs)
+}
+
+func (imgs *Images) Scan(src interface{}) error {
+	if src == nil {
+		*imgs = nil
+		return nil
+	}
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("Images.Scan: unsupported type %T", src)
+	}
+	return json.Unmarshal(b, imgs)
+}
+
+const (
+	thumbSize = 400
+	medSize   = 1200
+	fullCap   = 2560
+)
+
+// migrateImagesColumn upgrades a blog_posts.images TEXT[] column from
+// before the image pipeline rework to JSONB, converting existing plain
+// upload paths into minimal Image objects so old posts keep rendering.
+func (a *App) migrateImagesColumn() error {
+	var dataType string
+	err := a.db.QueryRow(`
+        SELECT data_type FROM information_schema.columns
+        WHERE table_name='blog_posts' AND column_name='images'`).Scan(&dataType)
+	if err != nil || dataType == "jsonb" {
+		return nil
+	}
+	// Postgres rejects subqueries in ALTER COLUMN ... USING, so the JSONB
+	// value is built in a new column that then replaces the old one. The
+	// statements run as one implicit transaction.
+	_, err = a.db.Exec(`
+        ALTER TABLE blog_posts ADD COLUMN images_json JSONB NOT NULL DEFAULT '[]';
+        UPDATE blog_posts SET images_json = COALESCE(
+            (SELECT jsonb_agg(jsonb_build_object('full', u, 'med', u, 'thumb', u))
+             FROM unnest(images) AS u), '[]'::jsonb);
+        ALTER TABLE blog_posts DROP COLUMN images;
+        ALTER TABLE blog_posts RENAME COLUMN images_json TO images`)
+	return err
+}
+
+// ImageProcessor decodes uploads, strips EXIF (by decoding to raw pixels
+// and re-encoding), and writes thumb/med/full WebP variants under a
+// content-hash directory so identical uploads dedupe automatically.
+type ImageProcessor struct {
+	Dir string
+}
+
+func newImageProcessor() *ImageProcessor {
+	return &ImageProcessor{Dir: "uploads"}
+}
+
+// Process decodes each uploaded file and produces its resized variants.
+func (ip *ImageProcessor) Process(files []*multipart.FileHeader) ([]Image, error) {
+	var out []Image
+	for _, fh := range files {
+		src, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		raw, err := io.ReadAll(src)
+		src.Close()
+		if err != nil {
+			return nil, err
+		}
+		img, err := ip.processOne(raw)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, img)
+	}
+	return out, nil
+}
+
+// ProcessBytes is Process for callers that already have decoded image
+// bytes in hand, e.g. the base64 JSON API.
+func (ip *ImageProcessor) ProcessBytes(images [][]byte) ([]Image, error) {
+	var out []Image
+	for _, raw := range images {
+		img, err := ip.processOne(raw)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, img)
+	}
+	return out, nil
+}
+
+func (ip *ImageProcessor) processOne(raw []byte) (Image, error) {
+	// Decoding to an image.Image and re-encoding drops any EXIF block
+	// embedded in the original file, since only pixel data survives.
+	srcImg, _, err := decodeImage(raw)
+	if err != nil {
+		return Image{}, err
+	}
+
+	hash := sha256.Sum256(raw)
+	dir := filepath.Join(ip.Dir, hex.EncodeToString(hash[:]))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Image{}, err
+	}
+
+	bounds := srcImg.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	full := imaging.Fit(srcImg, fullCap, fullCap, imaging.Lanczos)
+	med := imaging.Fit(srcImg, medSize, medSize, imaging.Lanczos)
+	thumb := imaging.Fill(srcImg, thumbSize, thumbSize, imaging.Center, imaging.Lanczos)
+
+	fullPath := filepath.Join(dir, "full.webp")
+	medPath := filepath.Join(dir, "med.webp")
+	thumbPath := filepath.Join(dir, "thumb.webp")
+
+	if err := writeWebP(fullPath, full); err != nil {
+		return Image{}, err
+	}
+	if err := writeWebP(medPath, med); err != nil {
+		return Image{}, err
+	}
+	if err := writeWebP(thumbPath, thumb); err != nil {
+		return Image{}, err
+	}
+
+	return Image{
+		Full:   "/" + fullPath,
+		Med:    "/" + medPath,
+		Thumb:  "/" + thumbPath,
+		Width:  width,
+		Height: height,
+		Mime:   "image/webp",
+	}, nil
+}
+
+// decodeImage supports the three formats this blog has historically
+// accepted uploads in: JPEG, PNG, and WebP.
+func decodeImage(raw []byte) (image.Image, string, error) {
+	r := bytes.NewReader(raw)
+	if img, err := jpeg.Decode(r); err == nil {
+		return img, "jpeg", nil
+	}
+	r.Seek(0, io.SeekStart)
+	if img, err := png.Decode(r); err == nil {
+		return img, "png", nil
+	}
+	r.Seek(0, io.SeekStart)
+	if img, err := xwebp.Decode(r); err == nil {
+		return img, "webp", nil
+	}
+	return nil, "", fmt.Errorf("unsupported image format")
+}
+
+func writeWebP(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return webp.Encode(f, img, &webp.Options{Quality: 85})
+}
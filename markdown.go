@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+)
+
+var hashtagRe = regexp.MustCompile(`#(\w+)`)
+
+// mdPolicy is a UGC (user-generated content) sanitization policy applied
+// to every rendered post body before it reaches a template. Relative URLs
+// are allowed so the hashtag links linkifyHashtags inserts aren't stripped.
+var mdPolicy = bluemonday.UGCPolicy().AllowRelativeURLs(true)
+
+// linkifyHashtags rewrites #hashtag occurrences into Markdown links to
+// their tag page, ahead of the goldmark conversion.
+func linkifyHashtags(text string) string {
+	return hashtagRe.ReplaceAllStringFunc(text, func(m string) string {
+		tag := strings.ToLower(hashtagRe.FindStringSubmatch(m)[1])
+		return fmt.Sprintf("[%s](/tag/%s)", m, tag)
+	})
+}
+
+// renderMarkdown converts Post.Text (stored as Markdown) to sanitized
+// HTML, linkifying #hashtags to their tag page along the way. It is
+// exposed to templates as the "markdown" func.
+func renderMarkdown(text string) template.HTML {
+	var buf strings.Builder
+	if err := goldmark.Convert([]byte(linkifyHashtags(text)), &buf); err != nil {
+		return template.HTML(template.HTMLEscapeString(text))
+	}
+	return template.HTML(mdPolicy.SanitizeBytes([]byte(buf.String())))
+}
+
+func init() {
+	funcMap["markdown"] = renderMarkdown
+}
+
+// extractHashtags returns the distinct lowercased #hashtags in body,
+// in order of first appearance.
+func extractHashtags(body string) []string {
+	matches := hashtagRe.FindAllStringSubmatch(body, -1)
+	seen := map[string]bool{}
+	var tags []string
+	for _, m := range matches {
+		tag := strings.ToLower(m[1])
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func (a *App) createTagTables() error {
+	_, err := a.db.Exec(`
+        CREATE TABLE IF NOT EXISTS post_tags(
+            post_id UUID NOT NULL REFERENCES blog_posts(id) ON DELETE CASCADE,
+            tag     TEXT NOT NULL,
+            PRIMARY KEY (post_id, tag)
+        )
+    `)
+	return err
+}
+
+func (a *App) insertPostTags(postID string, tags []string) error {
+	for _, tag := range tags {
+		if _, err := a.db.Exec(`INSERT INTO post_tags(post_id, tag) VALUES($1,$2) ON CONFLICT DO NOTHING`,
+			postID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getPostsByTagPage mirrors getPostsPage but restricted to posts bearing
+// the given tag.
+func (a *App) getPostsByTagPage(tag string, page, perPage int) ([]Post, int, error) {
+	var total int
+	a.db.QueryRow(`
+        SELECT count(*) FROM blog_posts p JOIN post_tags t ON t.post_id=p.id
+        WHERE t.tag=$1 AND `+publishedWhere, tag).Scan(&total)
+
+	rows, err := a.db.Query(`
+        SELECT p.id::text, p.title, p.body, p.images, p.date
+        FROM blog_posts p JOIN post_tags t ON t.post_id = p.id
+        WHERE t.tag = $1 AND `+publishedWhere+`
+        ORDER BY p.date DESC LIMIT $2 OFFSET $3`,
+		tag, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var posts []Post
+	for rows.Next() {
+		var p Post
+		if err := rows.Scan(&p.ID, &p.Title, &p.Text, &p.Images, &p.Date); err != nil {
+			return nil, 0, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, total, rows.Err()
+}
+
+// handleTag renders a paginated listing of posts tagged with {name}.
+func (a *App) handleTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tag := strings.ToLower(strings.TrimPrefix(r.URL.Path, "/tag/"))
+	if tag == "" {
+		http.NotFound(w, r)
+		return
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage := 3
+	posts, total, err := a.getPostsByTagPage(tag, page, perPage)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	last := (total + perPage - 1) / perPage
+	data := map[string]interface{}{
+		"Tag": tag, "Posts": posts, "Page": page, "Last": last,
+	}
+	if err := a.tmpl.ExecuteTemplate(w, "tag.html", data); err != nil {
+		log.Println(err)
+	}
+}
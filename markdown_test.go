@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestExtractHashtags(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"no hashtags", "just some text", nil},
+		{"single hashtag", "hello #world", []string{"world"}},
+		{"dedupes and lowercases, keeps first-seen order", "#Go is great, #go rocks, #rust too", []string{"go", "rust"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := extractHashtags(c.body)
+			if len(got) != len(c.want) {
+				t.Fatalf("extractHashtags(%q) = %v, want %v", c.body, got, c.want)
+			}
+			for i := range got {
+				if got[i] != c.want[i] {
+					t.Fatalf("extractHashtags(%q) = %v, want %v", c.body, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLinkifyHashtags(t *testing.T) {
+	got := linkifyHashtags("check out #GoLang today")
+	want := "check out [#GoLang](/tag/golang) today"
+	if got != want {
+		t.Errorf("linkifyHashtags() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// SearchResult is a Post together with a highlighted snippet of the
+// matching text, as returned by ts_headline.
+type SearchResult struct {
+	Post
+	Snippet string
+}
+
+func (a *App) createSearchIndex() error {
+	_, err := a.db.Exec(`
+        ALTER TABLE blog_posts
+        ADD COLUMN IF NOT EXISTS search_doc tsvector
+        GENERATED ALWAYS AS (to_tsvector('english', title || ' ' || body)) STORED
+    `)
+	if err != nil {
+		return err
+	}
+	_, err = a.db.Exec(`CREATE INDEX IF NOT EXISTS blog_posts_search_doc_idx ON blog_posts USING GIN(search_doc)`)
+	return err
+}
+
+// searchPosts runs a ranked full-text search over blog_posts and returns
+// a page of matches with highlighted snippets.
+func (a *App) searchPosts(q string, page, perPage int) ([]SearchResult, int, error) {
+	var total int
+	if err := a.db.QueryRow(`
+        SELECT count(*) FROM blog_posts
+        WHERE search_doc @@ plainto_tsquery('english', $1) AND `+publishedWhere,
+		q).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := a.db.Query(`
+        SELECT id::text, title, body, images, date,
+               ts_headline('english', body, plainto_tsquery('english', $1))
+        FROM blog_posts
+        WHERE search_doc @@ plainto_tsquery('english', $1) AND `+publishedWhere+`
+        ORDER BY ts_rank_cd(search_doc, plainto_tsquery('english', $1)) DESC
+        LIMIT $2 OFFSET $3`,
+		q, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		if err := rows.Scan(&r.ID, &r.Title, &r.Text, &r.Images, &r.Date, &r.Snippet); err != nil {
+			return nil, 0, err
+		}
+		results = append(results, r)
+	}
+	return results, total, rows.Err()
+}
+
+// handleSearch renders search.html with the results for ?q=.
+func (a *App) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query().Get("q")
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage := 3
+
+	var (
+		results []SearchResult
+		total   int
+		err     error
+	)
+	if q != "" {
+		results, total, err = a.searchPosts(q, page, perPage)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+	last := (total + perPage - 1) / perPage
+	data := map[string]interface{}{
+		"Query": q, "Results": results, "Page": page, "Last": last,
+	}
+	if err := a.tmpl.ExecuteTemplate(w, "search.html", data); err != nil {
+		log.Println(err)
+	}
+}
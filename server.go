@@ -1,341 +1,450 @@
-package main
-
-import (
-	"database/sql"
-	"embed"
-	"encoding/json"
-	"fmt"
-	"html/template"
-	"io"
-	"log"
-	"mime/multipart"
-	"net/http"
-	"os"
-	"path/filepath"
-	"strconv"
-	"time"
-
-	"github.com/lib/pq"
-)
-
-//go:embed tmpl/*.html
-var tmplFS embed.FS
-
-var funcMap = template.FuncMap{
-	"minus": func(a, b int) int { return a - b },
-	"plus":  func(a, b int) int { return a + b },
-	"slice": func(s string, start, end int) string {
-		if start > len(s) {
-			return ""
-		}
-		if end > len(s) {
-			end = len(s)
-		}
-		return s[start:end]
-	},
-}
-
-var (
-	db       *sql.DB
-	tmpl     = template.Must(template.New("").Funcs(funcMap).ParseFS(tmplFS, "tmpl/*.html"))
-	username = "username"
-	password = "password"
-)
-
-type DBConfig struct {
-	Host, User, Password, DBName string
-	Port                         int
-}
-
-type Post struct {
-	ID     string
-	Title  string
-	Text   string
-	Images []string
-	Date   time.Time
-}
-
-func main() {
-	cfg := mustLoadConfig()
-	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName)
-
-	var err error
-	db, err = sql.Open("postgres", dsn)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
-	if err := db.Ping(); err != nil {
-		log.Fatal(err)
-	}
-	if err := createTables(); err != nil {
-		log.Fatal(err)
-	}
-
-	http.HandleFunc("/", handleMain)
-	http.HandleFunc("/blog/", handleBlog)
-	http.HandleFunc("/post/", handlePost)
-	http.HandleFunc("/create", handleCreateForm)
-	http.HandleFunc("/create/post", handleCreatePost)
-	http.HandleFunc("/create/letter", handleCreateLetter)
-	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
-	http.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir("uploads"))))
-
-	log.Println("Listening :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
-}
-
-func handleMain(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Path != "/" {
-		http.NotFound(w, r)
-		return
-	}
-
-	messages, err := getMessages()
-	if err != nil {
-		log.Println("Error getting messages:", err)
-		messages = []struct {
-			Name    string
-			Email   string
-			Message string
-			Date    time.Time
-		}{}
-	}
-
-	data := map[string]interface{}{
-		"Messages": messages,
-	}
-
-	tmpl.ExecuteTemplate(w, "index.html", data)
-}
-
-func handleBlog(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	if page < 1 {
-		page = 1
-	}
-	perPage := 3
-	posts, total, err := getPostsPage(page, perPage)
-	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
-	}
-	last := (total + perPage - 1) / perPage
-	data := map[string]interface{}{
-		"Posts": posts, "Page": page, "Last": last,
-	}
-	if err := tmpl.ExecuteTemplate(w, "blog.html", data); err != nil {
-		log.Println(err)
-	}
-}
-
-func handlePost(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	id := filepath.Base(r.URL.Path)
-	p, err := getPost(id)
-	if err != nil {
-		http.Error(w, "post not found", 404)
-		return
-	}
-	if err := tmpl.ExecuteTemplate(w, "post.html", p); err != nil {
-		log.Println(err)
-	}
-}
-
-func handleCreateForm(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	tmpl.ExecuteTemplate(w, "login.html", nil)
-}
-func handleCreateLetter(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	formName := r.FormValue("name")
-	formMail := r.FormValue("mail")
-	formMessage := r.FormValue("message")
-	if err := insertMessage(formName, formMail, formMessage); err != nil {
-		http.Error(w, "Error inserting post: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	http.Redirect(w, r, "/", http.StatusFound)
-}
-func handleCreatePost(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	formLogin := r.FormValue("login")
-	formPass := r.FormValue("pass")
-	if formLogin != username || formPass != password {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-		return
-	}
-
-	title := r.FormValue("title")
-	text := r.FormValue("text")
-	files := r.MultipartForm.File["images"]
-
-	imgs, err := saveImages(files)
-	if err != nil {
-		http.Error(w, "Error saving images: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if err := insertPost(title, text, imgs); err != nil {
-		http.Error(w, "Error inserting post: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	http.Redirect(w, r, "/", http.StatusFound)
-}
-
-func createTables() error {
-	_, err := db.Exec(`
-        CREATE TABLE IF NOT EXISTS blog_posts(
-            id     UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-            title  VARCHAR(200) NOT NULL,
-            body   TEXT         NOT NULL,
-            images TEXT[]       NOT NULL,
-            date   TIMESTAMP DEFAULT NOW()
-        )
-    `)
-	if err != nil {
-		return err
-	}
-
-	_, err = db.Exec(`
-        CREATE TABLE IF NOT EXISTS hello_letters(
-            id      UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-            name    VARCHAR(45) NOT NULL,
-            email   VARCHAR(45) NOT NULL,
-            message TEXT NOT NULL,
-            date    TIMESTAMP DEFAULT NOW()
-        )
-    `)
-	return err
-}
-
-func insertPost(title, body string, images []string) error {
-	_, err := db.Exec(`INSERT INTO blog_posts(title,body,images) VALUES($1,$2,$3)`, title, body, pq.Array(images))
-	return err
-}
-func insertMessage(name string, mail string, message string) error {
-	_, err := db.Exec(`INSERT INTO hello_letters(name,email,message) VALUES($1,$2,$3)`, name, mail, message)
-	return err
-}
-func getPost(id string) (Post, error) {
-	var p Post
-	err := db.QueryRow(`SELECT id::text,title,body,images,date FROM blog_posts WHERE id=$1`, id).
-		Scan(&p.ID, &p.Title, &p.Text, pq.Array(&p.Images), &p.Date)
-	return p, err
-}
-func getMessages() ([]struct {
-	Name    string
-	Email   string
-	Message string
-	Date    time.Time
-}, error) {
-	rows, err := db.Query(`SELECT name, email, message, date FROM hello_letters ORDER BY date DESC LIMIT 5`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var messages []struct {
-		Name    string
-		Email   string
-		Message string
-		Date    time.Time
-	}
-
-	for rows.Next() {
-		var msg struct {
-			Name    string
-			Email   string
-			Message string
-			Date    time.Time
-		}
-		if err := rows.Scan(&msg.Name, &msg.Email, &msg.Message, &msg.Date); err != nil {
-			return nil, err
-		}
-		messages = append(messages, msg)
-	}
-	return messages, rows.Err()
-}
-func getPostsPage(page, perPage int) ([]Post, int, error) {
-	var total int
-	db.QueryRow(`SELECT count(*) FROM blog_posts`).Scan(&total)
-
-	rows, err := db.Query(`SELECT id::text,title,body,images,date
-	                        FROM blog_posts ORDER BY date DESC LIMIT $1 OFFSET $2`,
-		perPage, (page-1)*perPage)
-	if err != nil {
-		return nil, 0, err
-	}
-	defer rows.Close()
-
-	var posts []Post
-	for rows.Next() {
-		var p Post
-		if err := rows.Scan(&p.ID, &p.Title, &p.Text, pq.Array(&p.Images), &p.Date); err != nil {
-			return nil, 0, err
-		}
-		posts = append(posts, p)
-	}
-	return posts, total, rows.Err()
-}
-
-func mustLoadConfig() DBConfig {
-	f, err := os.Open("db.json")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer f.Close()
-	var c DBConfig
-	if err := json.NewDecoder(f).Decode(&c); err != nil {
-		log.Fatal(err)
-	}
-	return c
-}
-
-func saveImages(files []*multipart.FileHeader) ([]string, error) {
-	dir := "uploads"
-	_ = os.MkdirAll(dir, 0755)
-	var paths []string
-	for _, fh := range files {
-		src, err := fh.Open()
-		if err != nil {
-			return nil, err
-		}
-		name := strconv.FormatInt(time.Now().UnixNano(), 10) + filepath.Ext(fh.Filename)
-		dst, err := os.Create(filepath.Join(dir, name))
-		if err != nil {
-			src.Close()
-			return nil, err
-		}
-		_, err = io.Copy(dst, src)
-		src.Close()
-		dst.Close()
-		if err != nil {
-			return nil, err
-		}
-		paths = append(paths, "/uploads/"+name)
-	}
-	return paths, nil
-}
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/sessions"
+	_ "github.com/lib/pq"
+)
+
+//go:embed tmpl/*.html
+var tmplFS embed.FS
+
+var funcMap = template.FuncMap{
+	"minus": func(a, b int) int { return a - b },
+	"plus":  func(a, b int) int { return a + b },
+	"slice": func(s string, start, end int) string {
+		if start > len(s) {
+			return ""
+		}
+		if end > len(s) {
+			end = len(s)
+		}
+		return s[start:end]
+	},
+}
+
+type DBConfig struct {
+	Host, User, Password, DBName string
+	Port                         int
+	SessionKey, CSRFKey          string
+	PublicHost                   string
+}
+
+type Post struct {
+	ID           string     `json:"id"`
+	Title        string     `json:"title"`
+	Text         string     `json:"text"`
+	Images       Images     `json:"images"`
+	Date         time.Time  `json:"date"`
+	Status       string     `json:"status"`
+	PublishAt    *time.Time `json:"publish_at,omitempty"`
+	PreviewToken string     `json:"-"`
+}
+
+// App owns every piece of shared state a handler needs: the database
+// connection, parsed templates, and session/rate-limiting state. Handlers
+// are methods on App instead of free functions bound to package globals,
+// so multiple Apps (e.g. in tests) can run side by side.
+type App struct {
+	db       *sql.DB
+	tmpl     *template.Template
+	sessions *sessions.CookieStore
+	csrfKey  []byte
+	host     string // public host used to federate posts with no inbound request, e.g. scheduled promotion
+
+	loginLimiter  *rateLimiter
+	letterLimiter *rateLimiter
+
+	images *ImageProcessor
+}
+
+// NewApp opens the database, verifies connectivity, ensures the schema
+// exists, and returns a ready-to-serve App.
+func NewApp(cfg DBConfig) (*App, error) {
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName)
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	a := &App{
+		db:            db,
+		tmpl:          template.Must(template.New("").Funcs(funcMap).ParseFS(tmplFS, "tmpl/*.html")),
+		sessions:      sessions.NewCookieStore([]byte(cfg.SessionKey)),
+		csrfKey:       []byte(cfg.CSRFKey),
+		host:          cfg.PublicHost,
+		loginLimiter:  newRateLimiter(5, time.Minute),
+		letterLimiter: newRateLimiter(5, time.Minute),
+		images:        newImageProcessor(),
+	}
+	if err := a.createTables(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := a.createAPTables(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := a.createTagTables(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := a.createSearchIndex(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := a.createUserTables(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := a.createDraftColumns(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := a.migrateImagesColumn(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// Close releases the App's database connection.
+func (a *App) Close() error {
+	return a.db.Close()
+}
+
+// Mux builds the http.ServeMux routing requests to this App's handlers.
+func (a *App) Mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", a.handleMain)
+	mux.HandleFunc("/blog/", a.handleBlog)
+	mux.HandleFunc("/post/", a.handlePreviewablePost)
+	mux.HandleFunc("/login", a.handleLoginForm)
+	mux.HandleFunc("/login/post", a.handleLogin)
+	mux.Handle("/create", a.csrfMiddleware(a.requireAuth(a.handleCreateForm)))
+	mux.Handle("/create/post", a.csrfMiddleware(a.requireAuth(a.handleCreatePost)))
+	mux.HandleFunc("/create/letter", a.handleCreateLetter)
+	mux.HandleFunc("/.well-known/webfinger", a.handleWebfinger)
+	mux.HandleFunc("/ap/actor", a.handleActor)
+	mux.HandleFunc("/ap/actor/inbox", a.handleInbox)
+	mux.HandleFunc("/ap/actor/outbox", a.handleOutbox)
+	mux.HandleFunc("/ap/actor/followers", a.handleFollowers)
+	mux.HandleFunc("/tag/", a.handleTag)
+	mux.HandleFunc("/search", a.handleSearch)
+	mux.HandleFunc("/api/v1/posts", a.handleAPIPosts)
+	mux.HandleFunc("/api/v1/posts/", a.handleAPIPost)
+	mux.HandleFunc("/api/v1/letters", a.handleAPILetters)
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+	mux.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir("uploads"))))
+	return mux
+}
+
+func main() {
+	cfg := mustLoadConfig()
+	app, err := NewApp(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer app.Close()
+
+	if len(os.Args) > 1 && os.Args[1] == "adduser" {
+		if len(os.Args) != 3 {
+			log.Fatal("usage: simpleblog adduser <name>")
+		}
+		runAddUser(app, os.Args[2])
+		return
+	}
+
+	app.startScheduledPublisher()
+
+	srv := &http.Server{Addr: ":8080", Handler: app.Mux()}
+
+	go func() {
+		log.Println("Listening :8080")
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Println("Shutdown error:", err)
+	}
+}
+
+func (a *App) handleMain(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	messages, err := a.getMessages()
+	if err != nil {
+		log.Println("Error getting messages:", err)
+		messages = []struct {
+			Name    string
+			Email   string
+			Message string
+			Date    time.Time
+		}{}
+	}
+
+	data := map[string]interface{}{
+		"Messages": messages,
+	}
+
+	a.tmpl.ExecuteTemplate(w, "index.html", data)
+}
+
+func (a *App) handleBlog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage := 3
+	posts, total, err := a.getPostsPage(page, perPage)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	last := (total + perPage - 1) / perPage
+	data := map[string]interface{}{
+		"Posts": posts, "Page": page, "Last": last,
+	}
+	if err := a.tmpl.ExecuteTemplate(w, "blog.html", data); err != nil {
+		log.Println(err)
+	}
+}
+
+func (a *App) handleLoginForm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.tmpl.ExecuteTemplate(w, "login.html", nil)
+}
+func (a *App) handleCreateForm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	data := map[string]interface{}{
+		"csrfField": csrf.TemplateField(r),
+	}
+	a.tmpl.ExecuteTemplate(w, "create.html", data)
+}
+func (a *App) handleCreateLetter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.letterLimiter.Allow(clientIP(r)) {
+		http.Error(w, "too many messages, try again later", http.StatusTooManyRequests)
+		return
+	}
+	formName := r.FormValue("name")
+	formMail := r.FormValue("mail")
+	formMessage := r.FormValue("message")
+	if err := a.insertMessage(formName, formMail, formMessage); err != nil {
+		http.Error(w, "Error inserting post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+func (a *App) handleCreatePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		http.Error(w, "Error parsing form: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	title := r.FormValue("title")
+	text := r.FormValue("text")
+	files := r.MultipartForm.File["images"]
+
+	status, publishAt, err := parseScheduleForm(r.FormValue("status"), r.FormValue("publish_at"))
+	if err != nil {
+		http.Error(w, "Error parsing schedule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	imgs, err := a.images.Process(files)
+	if err != nil {
+		http.Error(w, "Error saving images: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	p, err := a.insertPost(title, text, imgs, status, publishAt)
+	if err != nil {
+		http.Error(w, "Error inserting post: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := a.insertPostTags(p.ID, extractHashtags(p.Text)); err != nil {
+		log.Println("insertPostTags:", err)
+	}
+	if p.Status == StatusPublished {
+		go a.federatePost(r.Host, p)
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (a *App) createTables() error {
+	_, err := a.db.Exec(`
+        CREATE TABLE IF NOT EXISTS blog_posts(
+            id     UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            title  VARCHAR(200) NOT NULL,
+            body   TEXT         NOT NULL,
+            images JSONB        NOT NULL DEFAULT '[]',
+            date   TIMESTAMP DEFAULT NOW()
+        )
+    `)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.db.Exec(`
+        CREATE TABLE IF NOT EXISTS hello_letters(
+            id      UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            name    VARCHAR(45) NOT NULL,
+            email   VARCHAR(45) NOT NULL,
+            message TEXT NOT NULL,
+            date    TIMESTAMP DEFAULT NOW()
+        )
+    `)
+	return err
+}
+
+// insertPost creates a post with the given status ("draft", "scheduled",
+// or "published") and, for scheduled posts, the time it should go live.
+func (a *App) insertPost(title, body string, images Images, status string, publishAt *time.Time) (Post, error) {
+	token, err := newPreviewToken()
+	if err != nil {
+		return Post{}, err
+	}
+	p := Post{Title: title, Text: body, Images: images, Status: status, PublishAt: publishAt, PreviewToken: token}
+	err = a.db.QueryRow(`
+        INSERT INTO blog_posts(title,body,images,status,publish_at,preview_token)
+        VALUES($1,$2,$3,$4,$5,$6) RETURNING id::text, date`,
+		title, body, images, status, publishAt, token).Scan(&p.ID, &p.Date)
+	return p, err
+}
+func (a *App) insertMessage(name string, mail string, message string) error {
+	_, err := a.db.Exec(`INSERT INTO hello_letters(name,email,message) VALUES($1,$2,$3)`, name, mail, message)
+	return err
+}
+func (a *App) getPost(id string) (Post, error) {
+	var p Post
+	err := a.db.QueryRow(`
+        SELECT id::text,title,body,images,date,status,publish_at,preview_token
+        FROM blog_posts WHERE id=$1`, id).
+		Scan(&p.ID, &p.Title, &p.Text, &p.Images, &p.Date, &p.Status, &p.PublishAt, &p.PreviewToken)
+	return p, err
+}
+func (a *App) getMessages() ([]struct {
+	Name    string
+	Email   string
+	Message string
+	Date    time.Time
+}, error) {
+	rows, err := a.db.Query(`SELECT name, email, message, date FROM hello_letters ORDER BY date DESC LIMIT 5`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []struct {
+		Name    string
+		Email   string
+		Message string
+		Date    time.Time
+	}
+
+	for rows.Next() {
+		var msg struct {
+			Name    string
+			Email   string
+			Message string
+			Date    time.Time
+		}
+		if err := rows.Scan(&msg.Name, &msg.Email, &msg.Message, &msg.Date); err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// publishedWhere restricts a blog_posts query to posts that are live:
+// status "published" with no publish_at or one that has passed. Scheduled
+// posts are excluded until promoteScheduledPosts flips them to published.
+const publishedWhere = `status='published' AND (publish_at IS NULL OR publish_at <= NOW())`
+
+func (a *App) getPostsPage(page, perPage int) ([]Post, int, error) {
+	var total int
+	a.db.QueryRow(`SELECT count(*) FROM blog_posts WHERE ` + publishedWhere).Scan(&total)
+
+	rows, err := a.db.Query(`SELECT id::text,title,body,images,date
+	                        FROM blog_posts WHERE `+publishedWhere+`
+	                        ORDER BY date DESC LIMIT $1 OFFSET $2`,
+		perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var posts []Post
+	for rows.Next() {
+		var p Post
+		if err := rows.Scan(&p.ID, &p.Title, &p.Text, &p.Images, &p.Date); err != nil {
+			return nil, 0, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, total, rows.Err()
+}
+
+func mustLoadConfig() DBConfig {
+	f, err := os.Open("db.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	var c DBConfig
+	if err := json.NewDecoder(f).Decode(&c); err != nil {
+		log.Fatal(err)
+	}
+	return c
+}
+